@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -17,6 +18,10 @@ import (
 // ProviderName provides a name of EC2Role provider
 const ProviderName = "EC2RoleProvider"
 
+// DefaultCooldownPeriod is the amount of time the circuit breaker stays open
+// if FailureThreshold is set but CooldownPeriod is not.
+var DefaultCooldownPeriod = time.Minute
+
 // A EC2RoleProvider retrieves credentials from the EC2 service, and keeps track if
 // those credentials are expired.
 //
@@ -34,6 +39,20 @@ const ProviderName = "EC2RoleProvider"
 //         // specified the credentials will be expired early
 //         ExpiryWindow: 0,
 //     }
+//
+// Retries and backoff of the individual metadata requests are controlled by
+// the EC2Metadata client's Config.MaxRetries and Config.Retryer. To stop a
+// flaky or absent metadata service from being called on every Retrieve,
+// enable the circuit breaker with FailureThreshold and CooldownPeriod.
+//
+//     p := &ec2rolecreds.EC2RoleProvider{
+//         Client: ec2metadata.New(sess, aws.NewConfig().WithMaxRetries(5)),
+//
+//         // Stop calling the metadata service for a minute after three
+//         // consecutive failed Retrieve calls.
+//         FailureThreshold: 3,
+//         CooldownPeriod:   time.Minute,
+//     }
 type EC2RoleProvider struct {
 	credentials.Expiry
 
@@ -50,6 +69,40 @@ type EC2RoleProvider struct {
 	//
 	// If ExpiryWindow is 0 or less it will be ignored.
 	ExpiryWindow time.Duration
+
+	// FailureThreshold is the number of consecutive failed Retrieve calls
+	// after which the circuit breaker opens. While open, Retrieve returns an
+	// EC2RoleCircuitOpen error without calling the metadata service.
+	//
+	// If FailureThreshold is 0 or less the circuit breaker is disabled.
+	FailureThreshold int
+
+	// CooldownPeriod is how long the circuit breaker stays open before
+	// Retrieve will call the metadata service again. Defaults to
+	// DefaultCooldownPeriod if 0 or less.
+	CooldownPeriod time.Duration
+
+	mu           sync.Mutex
+	stats        Stats
+	failures     int
+	lastErr      error
+	circuitUntil time.Time
+}
+
+// Stats provides counters of the EC2RoleProvider's calls to the EC2 metadata
+// service.
+type Stats struct {
+	// Number of Retrieve calls which requested credentials from the
+	// metadata service.
+	Attempts int64
+
+	// Number of Retrieve calls which failed to get credentials from the
+	// metadata service.
+	Failures int64
+
+	// Number of Retrieve calls which returned an error without calling the
+	// metadata service because the circuit breaker was open.
+	ShortCircuits int64
 }
 
 // NewCredentials returns a pointer to a new Credentials object wrapping
@@ -84,19 +137,15 @@ func NewCredentialsWithClient(client *ec2metadata.EC2Metadata, options ...func(*
 
 // Retrieve retrieves credentials from the EC2 service.
 // Error will be returned if the request fails, or unable to extract
-// the desired credentials.
+// the desired credentials. If the circuit breaker is open an
+// EC2RoleCircuitOpen error is returned without making a request.
 func (m *EC2RoleProvider) Retrieve() (credentials.Value, error) {
-	credsList, err := requestCredList(m.Client)
-	if err != nil {
+	if err := m.checkCircuit(); err != nil {
 		return credentials.Value{ProviderName: ProviderName}, err
 	}
 
-	if len(credsList) == 0 {
-		return credentials.Value{ProviderName: ProviderName}, awserr.New("EmptyEC2RoleList", "empty EC2 Role list", nil)
-	}
-	credsName := credsList[0]
-
-	roleCreds, err := requestCred(m.Client, credsName)
+	roleCreds, err := m.retrieveCred()
+	m.recordResult(err)
 	if err != nil {
 		return credentials.Value{ProviderName: ProviderName}, err
 	}
@@ -111,6 +160,79 @@ func (m *EC2RoleProvider) Retrieve() (credentials.Value, error) {
 	}, nil
 }
 
+// Stats returns a snapshot of the provider's metadata service call counters.
+func (m *EC2RoleProvider) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.stats
+}
+
+// retrieveCred requests the credentials of the first role listed by the EC2
+// metadata service.
+func (m *EC2RoleProvider) retrieveCred() (ec2RoleCredRespBody, error) {
+	credsList, err := requestCredList(m.Client)
+	if err != nil {
+		return ec2RoleCredRespBody{}, err
+	}
+
+	if len(credsList) == 0 {
+		return ec2RoleCredRespBody{}, awserr.New("EmptyEC2RoleList", "empty EC2 Role list", nil)
+	}
+
+	return requestCred(m.Client, credsList[0])
+}
+
+// checkCircuit returns an error if the circuit breaker is open, otherwise
+// the attempt is counted and nil is returned.
+func (m *EC2RoleProvider) checkCircuit() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.now().Before(m.circuitUntil) {
+		m.stats.ShortCircuits++
+		return awserr.New("EC2RoleCircuitOpen",
+			fmt.Sprintf("EC2 metadata service failed %d consecutive times, not retrying until %s",
+				m.failures, m.circuitUntil.Format(time.RFC3339)),
+			m.lastErr)
+	}
+
+	m.stats.Attempts++
+	return nil
+}
+
+// recordResult updates the failure counters with the result of a call to
+// the metadata service, opening the circuit breaker once FailureThreshold
+// consecutive failures have been seen.
+func (m *EC2RoleProvider) recordResult(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err == nil {
+		m.failures = 0
+		m.lastErr = nil
+		return
+	}
+
+	m.stats.Failures++
+	m.failures++
+	m.lastErr = err
+	if m.FailureThreshold > 0 && m.failures >= m.FailureThreshold {
+		cooldown := m.CooldownPeriod
+		if cooldown <= 0 {
+			cooldown = DefaultCooldownPeriod
+		}
+		m.circuitUntil = m.now().Add(cooldown)
+	}
+}
+
+func (m *EC2RoleProvider) now() time.Time {
+	if m.CurrentTime != nil {
+		return m.CurrentTime()
+	}
+	return time.Now()
+}
+
 // A ec2RoleCredRespBody provides the shape for unmarshalling credential
 // request responses.
 type ec2RoleCredRespBody struct {
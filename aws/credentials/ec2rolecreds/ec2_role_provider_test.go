@@ -138,6 +138,94 @@ func TestEC2RoleProviderExpiryWindowIsExpired(t *testing.T) {
 	assert.True(t, p.IsExpired(), "Expect creds to be expired.")
 }
 
+func TestEC2RoleProviderCircuitBreaker(t *testing.T) {
+	server := initTestServer("2014-12-16T01:51:37Z", true)
+	defer server.Close()
+
+	p := &ec2rolecreds.EC2RoleProvider{
+		Client:           ec2metadata.New(session.New(), &aws.Config{Endpoint: aws.String(server.URL + "/latest")}),
+		FailureThreshold: 2,
+		CooldownPeriod:   time.Minute,
+	}
+	now := time.Date(2014, 12, 15, 21, 26, 0, 0, time.UTC)
+	p.CurrentTime = func() time.Time {
+		return now
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := p.Retrieve()
+		assert.Equal(t, "ErrorCode", err.(awserr.Error).Code(), "Expect metadata service error")
+	}
+
+	_, err := p.Retrieve()
+	e := err.(awserr.Error)
+	assert.Equal(t, "EC2RoleCircuitOpen", e.Code(), "Expect circuit open error")
+	assert.Equal(t, "ErrorCode", e.OrigErr().(awserr.Error).Code(), "Expect last error to be wrapped")
+
+	now = now.Add(time.Minute)
+	_, err = p.Retrieve()
+	assert.Equal(t, "ErrorCode", err.(awserr.Error).Code(), "Expect metadata service to be called after cooldown")
+
+	assert.Equal(t, ec2rolecreds.Stats{Attempts: 3, Failures: 3, ShortCircuits: 1}, p.Stats())
+}
+
+func TestEC2RoleProviderCircuitBreakerResetOnSuccess(t *testing.T) {
+	failServer := initTestServer("2014-12-16T01:51:37Z", true)
+	defer failServer.Close()
+	successServer := initTestServer("2014-12-16T01:51:37Z", false)
+	defer successServer.Close()
+
+	failClient := ec2metadata.New(session.New(), &aws.Config{Endpoint: aws.String(failServer.URL + "/latest")})
+	successClient := ec2metadata.New(session.New(), &aws.Config{Endpoint: aws.String(successServer.URL + "/latest")})
+
+	p := &ec2rolecreds.EC2RoleProvider{
+		Client:           failClient,
+		FailureThreshold: 2,
+		CooldownPeriod:   time.Minute,
+	}
+
+	_, err := p.Retrieve()
+	assert.Equal(t, "ErrorCode", err.(awserr.Error).Code(), "Expect metadata service error")
+
+	p.Client = successClient
+	_, err = p.Retrieve()
+	assert.Nil(t, err, "Expect no error, %v", err)
+
+	p.Client = failClient
+	_, err = p.Retrieve()
+	assert.Equal(t, "ErrorCode", err.(awserr.Error).Code(), "Expect metadata service error")
+
+	_, err = p.Retrieve()
+	assert.Equal(t, "ErrorCode", err.(awserr.Error).Code(), "Expect circuit to stay closed after success reset the failure count")
+
+	assert.Equal(t, ec2rolecreds.Stats{Attempts: 4, Failures: 3}, p.Stats())
+}
+
+func TestEC2RoleProviderCircuitBreakerDefaultCooldown(t *testing.T) {
+	server := initTestServer("2014-12-16T01:51:37Z", true)
+	defer server.Close()
+
+	p := &ec2rolecreds.EC2RoleProvider{
+		Client:           ec2metadata.New(session.New(), &aws.Config{Endpoint: aws.String(server.URL + "/latest")}),
+		FailureThreshold: 1,
+	}
+	now := time.Date(2014, 12, 15, 21, 26, 0, 0, time.UTC)
+	p.CurrentTime = func() time.Time {
+		return now
+	}
+
+	_, err := p.Retrieve()
+	assert.Equal(t, "ErrorCode", err.(awserr.Error).Code(), "Expect metadata service error")
+
+	now = now.Add(ec2rolecreds.DefaultCooldownPeriod - time.Second)
+	_, err = p.Retrieve()
+	assert.Equal(t, "EC2RoleCircuitOpen", err.(awserr.Error).Code(), "Expect circuit open error")
+
+	now = now.Add(time.Second)
+	_, err = p.Retrieve()
+	assert.Equal(t, "ErrorCode", err.(awserr.Error).Code(), "Expect metadata service to be called after default cooldown")
+}
+
 func BenchmarkEC3RoleProvider(b *testing.B) {
 	server := initTestServer("2014-12-16T01:51:37Z", false)
 	defer server.Close()
@@ -5,10 +5,20 @@
 package stscreds
 
 import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/service/sts"
@@ -17,6 +27,12 @@ import (
 // ProviderName provides a name of AssumeRole provider
 const ProviderName = "AssumeRoleProvider"
 
+// ErrCodeCrossPartition is the error code returned by Retrieve when the role
+// to be assumed is in a different AWS partition (e.g. aws-cn or aws-us-gov)
+// than the STS client. Roles cannot be assumed across partitions, so the
+// request is not sent to STS.
+const ErrCodeCrossPartition = "CrossPartitionAssumeRole"
+
 // AssumeRoler represents the minimal subset of the STS client API used by this provider.
 type AssumeRoler interface {
 	AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error)
@@ -47,6 +63,21 @@ type AssumeRoleProvider struct {
 	// Optional ExternalID to pass along, defaults to nil if not set.
 	ExternalID *string
 
+	// The identification number of the MFA device that is associated with the
+	// user who is making the AssumeRole call. Defaults to nil if not set, in
+	// which case no MFA token is sent.
+	SerialNumber *string
+
+	// The value provided by the MFA device, if the trust policy of the role
+	// being assumed requires MFA. If SerialNumber is set and TokenCode is nil
+	// the TokenProvider will be used to get the token code.
+	TokenCode *string
+
+	// If SerialNumber is set and TokenCode is nil, TokenProvider will be called
+	// on each Retrieve to get the MFA token code. Use ChainTokenProviders to
+	// try several token sources in order.
+	TokenProvider func() (string, error)
+
 	// ExpiryWindow will allow the credentials to trigger refreshing prior to
 	// the credentials actually expiring. This is beneficial so race conditions
 	// with expiring credentials do not cause request to fail unexpectedly
@@ -57,6 +88,12 @@ type AssumeRoleProvider struct {
 	//
 	// If ExpiryWindow is 0 or less it will be ignored.
 	ExpiryWindow time.Duration
+
+	// assumedRoleUser is the identity of the session returned by the last
+	// successful AssumeRole call. Guarded by mu so AssumedRoleUser can be
+	// called while Retrieve is refreshing the credentials.
+	mu              sync.Mutex
+	assumedRoleUser *sts.AssumedRoleUser
 }
 
 // NewCredentials returns a pointer to a new Credentials object wrapping the
@@ -110,13 +147,26 @@ func (p *AssumeRoleProvider) Retrieve() (credentials.Value, error) {
 		// Expire as often as AWS permits.
 		p.Duration = DefaultDuration
 	}
+	if err := p.validatePartition(); err != nil {
+		return credentials.Value{ProviderName: ProviderName}, err
+	}
 
-	roleOutput, err := p.Client.AssumeRole(&sts.AssumeRoleInput{
+	input := &sts.AssumeRoleInput{
 		DurationSeconds: aws.Int64(int64(p.Duration / time.Second)),
 		RoleArn:         aws.String(p.RoleARN),
 		RoleSessionName: aws.String(p.RoleSessionName),
 		ExternalId:      p.ExternalID,
-	})
+	}
+	if p.SerialNumber != nil {
+		code, err := p.tokenCode()
+		if err != nil {
+			return credentials.Value{ProviderName: ProviderName}, err
+		}
+		input.SerialNumber = p.SerialNumber
+		input.TokenCode = aws.String(code)
+	}
+
+	roleOutput, err := p.Client.AssumeRole(input)
 
 	if err != nil {
 		return credentials.Value{ProviderName: ProviderName}, err
@@ -124,6 +174,7 @@ func (p *AssumeRoleProvider) Retrieve() (credentials.Value, error) {
 
 	// We will proactively generate new credentials before they expire.
 	p.SetExpiration(*roleOutput.Credentials.Expiration, p.ExpiryWindow)
+	p.setAssumedRoleUser(roleOutput.AssumedRoleUser)
 
 	return credentials.Value{
 		AccessKeyID:     *roleOutput.Credentials.AccessKeyId,
@@ -132,3 +183,219 @@ func (p *AssumeRoleProvider) Retrieve() (credentials.Value, error) {
 		ProviderName:    ProviderName,
 	}, nil
 }
+
+// AssumedRoleUser returns the ARN and assumed role ID of the session created
+// by the last successful Retrieve. The ARN identifies the role session, e.g.
+// arn:aws:sts::123456789012:assumed-role/role_name/session_name, and can be
+// used in resource policies and audit logs.
+//
+// A copy is returned, so it is safe to call from other goroutines while the
+// credentials are being refreshed. Returns nil if credentials have not been
+// retrieved yet.
+func (p *AssumeRoleProvider) AssumedRoleUser() *sts.AssumedRoleUser {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return copyAssumedRoleUser(p.assumedRoleUser)
+}
+
+// setAssumedRoleUser stores a copy of the AssumedRoleUser returned by STS.
+func (p *AssumeRoleProvider) setAssumedRoleUser(user *sts.AssumedRoleUser) {
+	user = copyAssumedRoleUser(user)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.assumedRoleUser = user
+}
+
+func copyAssumedRoleUser(user *sts.AssumedRoleUser) *sts.AssumedRoleUser {
+	if user == nil {
+		return nil
+	}
+	return &sts.AssumedRoleUser{
+		Arn:           aws.String(aws.StringValue(user.Arn)),
+		AssumedRoleId: aws.String(aws.StringValue(user.AssumedRoleId)),
+	}
+}
+
+// tokenCode returns the MFA token code to use for the AssumeRole request.
+func (p *AssumeRoleProvider) tokenCode() (string, error) {
+	if p.TokenCode != nil {
+		return *p.TokenCode, nil
+	}
+	if p.TokenProvider == nil {
+		return "", awserr.New("AssumeRoleTokenNotAvailable",
+			"assume role with MFA enabled, but neither TokenCode nor TokenProvider are set", nil)
+	}
+
+	code, err := p.TokenProvider()
+	if err == nil && code == "" {
+		err = errEmptyTokenCode
+	}
+	if err != nil {
+		return "", awserr.New("AssumeRoleTokenNotAvailable", "failed to get MFA token code", err)
+	}
+	return code, nil
+}
+
+// errEmptyTokenCode is returned when a token provider returns an empty token
+// code without an error. STS rejects empty token codes.
+var errEmptyTokenCode = awserr.New("EmptyTokenCode", "MFA token provider returned an empty token code", nil)
+
+// ChainTokenProviders returns a TokenProvider which tries each of the
+// providers in order, returning the first non-empty token code retrieved
+// without error. This allows unattended token sources, such as a TOTP secret
+// or hardware token, to be tried before falling back to prompting a user.
+//
+// If none of the providers return a token code a TokenProvidersFailed
+// BatchError containing each provider's error is returned. If no providers
+// are given a NoTokenProviders error is returned.
+//
+// Hardware tokens such as a YubiKey are not provided by this package, and can
+// be added to the chain as a caller supplied function.
+//
+//     p.TokenProvider = stscreds.ChainTokenProviders(
+//         stscreds.TOTPTokenProvider(os.Getenv("MFA_TOTP_SECRET")),
+//         yubikeyTokenProvider,
+//         stscreds.StdinTokenProvider,
+//     )
+func ChainTokenProviders(providers ...func() (string, error)) func() (string, error) {
+	providers = append([]func() (string, error){}, providers...)
+
+	return func() (string, error) {
+		if len(providers) == 0 {
+			return "", awserr.New("NoTokenProviders", "no MFA token providers configured in chain", nil)
+		}
+
+		var errs []error
+		for _, provider := range providers {
+			code, err := provider()
+			if err == nil && code == "" {
+				err = errEmptyTokenCode
+			}
+			if err == nil {
+				return code, nil
+			}
+			errs = append(errs, err)
+		}
+
+		return "", awserr.NewBatchError("TokenProvidersFailed", "no MFA token providers returned a token code", errs)
+	}
+}
+
+// StdinTokenProvider will prompt on stdout and read from stdin for a string
+// value. An error is returned if reading from stdin fails.
+//
+// Use this function to read MFA tokens from stdin. The function makes no
+// attempt to make atomic prompts from stdin across multiple goroutines.
+func StdinTokenProvider() (string, error) {
+	var v string
+	fmt.Fprint(os.Stdout, "Assume Role MFA token code: ")
+	_, err := fmt.Fscanln(os.Stdin, &v)
+
+	return v, err
+}
+
+// TOTPTokenProvider returns a TokenProvider which generates RFC 6238 time
+// based one-time passwords from the base32 encoded secret of a virtual MFA
+// device. The token codes are 6 digits using HMAC-SHA1 and a 30 second step,
+// matching the virtual MFA devices supported by IAM.
+//
+// An error is returned by the TokenProvider if the secret is empty or is not
+// valid base32.
+func TOTPTokenProvider(secret string) func() (string, error) {
+	secret = strings.ToUpper(strings.TrimRight(strings.Replace(secret, " ", "", -1), "="))
+	if n := len(secret) % 8; n != 0 {
+		secret += strings.Repeat("=", 8-n)
+	}
+	key, err := base32.StdEncoding.DecodeString(secret)
+	if err == nil && len(key) == 0 {
+		err = errors.New("secret is empty")
+	}
+
+	return func() (string, error) {
+		if err != nil {
+			return "", awserr.New("InvalidTOTPSecret", "failed to decode TOTP secret", err)
+		}
+		return totpCode(key, time.Now()), nil
+	}
+}
+
+// totpCode returns the 6 digit RFC 6238 token code for key at time t.
+func totpCode(key []byte, t time.Time) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/30))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0xf
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%06d", code%1000000)
+}
+
+// validatePartition returns an error if the RoleARN is in a different
+// partition than the STS client. The check is skipped if either partition
+// cannot be determined, such as when a custom AssumeRoler is used.
+func (p *AssumeRoleProvider) validatePartition() error {
+	svc, ok := p.Client.(*sts.STS)
+	if !ok {
+		return nil
+	}
+
+	// The signing region of global endpoints is always us-east-1, so prefer
+	// the configured region to find the client's partition.
+	region := aws.StringValue(svc.Config.Region)
+	if region == "" {
+		region = svc.SigningRegion
+	}
+
+	rolePartition := arnPartition(p.RoleARN)
+	clientPartition := regionPartition(region)
+	if rolePartition == "" || clientPartition == "" || rolePartition == clientPartition {
+		return nil
+	}
+
+	return awserr.New(ErrCodeCrossPartition,
+		fmt.Sprintf("role %s is in partition %s, but the STS client for region %s is in partition %s",
+			p.RoleARN, rolePartition, region, clientPartition),
+		nil)
+}
+
+// arnPartition returns the partition component of an ARN, or an empty
+// string if arn is not an ARN.
+func arnPartition(arn string) string {
+	parts := strings.SplitN(arn, ":", 3)
+	if len(parts) < 3 || parts[0] != "arn" {
+		return ""
+	}
+	return parts[1]
+}
+
+// Region name patterns of the partitions the cross partition check knows
+// about. Regions of any other partition, such as aws-iso, or custom regions
+// do not match and skip the check.
+var (
+	awsRegionRegexp      = regexp.MustCompile(`^(us|eu|ap|sa|ca|me|af|il|mx)-(north|south|east|west|central|northeast|northwest|southeast|southwest)-\d+$`)
+	awsCNRegionRegexp    = regexp.MustCompile(`^cn-(north|northwest)-\d+$`)
+	awsUSGovRegionRegexp = regexp.MustCompile(`^us-gov-(east|west)-\d+$`)
+)
+
+// regionPartition returns the partition the region belongs to, or an empty
+// string if the region is not set or is not in the aws, aws-cn or aws-us-gov
+// partitions.
+func regionPartition(region string) string {
+	switch {
+	case awsCNRegionRegexp.MatchString(region):
+		return "aws-cn"
+	case awsUSGovRegionRegexp.MatchString(region):
+		return "aws-us-gov"
+	case awsRegionRegexp.MatchString(region):
+		return "aws"
+	default:
+		return ""
+	}
+}
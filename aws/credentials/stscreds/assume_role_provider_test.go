@@ -1,10 +1,16 @@
 package stscreds
 
 import (
+	"errors"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/awstesting/unit"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/stretchr/testify/assert"
 )
@@ -22,6 +28,10 @@ func (s *stubSTS) AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput,
 			SessionToken:    aws.String("assumedSessionToken"),
 			Expiration:      &expiry,
 		},
+		AssumedRoleUser: &sts.AssumedRoleUser{
+			Arn:           aws.String("arn:aws:sts::123456789012:assumed-role/role_name/session_name"),
+			AssumedRoleId: aws.String("AROAEXAMPLE:session_name"),
+		},
 	}, nil
 }
 
@@ -40,6 +50,256 @@ func TestAssumeRoleProvider(t *testing.T) {
 	assert.Equal(t, "assumedSessionToken", creds.SessionToken, "Expect session token to match")
 }
 
+func TestAssumeRoleProviderAssumedRoleUser(t *testing.T) {
+	stub := &stubSTS{}
+	p := &AssumeRoleProvider{
+		Client:  stub,
+		RoleARN: "roleARN",
+	}
+
+	assert.Nil(t, p.AssumedRoleUser(), "Expect no assumed role user before retrieve")
+
+	_, err := p.Retrieve()
+	assert.Nil(t, err, "Expect no error")
+
+	user := p.AssumedRoleUser()
+	assert.Equal(t, "arn:aws:sts::123456789012:assumed-role/role_name/session_name", *user.Arn, "Expect assumed role ARN to match")
+	assert.Equal(t, "AROAEXAMPLE:session_name", *user.AssumedRoleId, "Expect assumed role ID to match")
+
+	*user.Arn = "modified"
+	assert.Equal(t, "arn:aws:sts::123456789012:assumed-role/role_name/session_name", *p.AssumedRoleUser().Arn, "Expect a copy to be returned")
+}
+
+func TestAssumeRoleProviderAssumedRoleUserConcurrentRetrieve(t *testing.T) {
+	stub := &stubSTS{}
+	p := &AssumeRoleProvider{
+		Client:  stub,
+		RoleARN: "roleARN",
+	}
+	creds := credentials.NewCredentials(p)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			creds.Expire()
+			_, err := creds.Get()
+			assert.Nil(t, err, "Expect no error")
+		}()
+		go func() {
+			defer wg.Done()
+			if user := p.AssumedRoleUser(); user != nil {
+				assert.Equal(t, "AROAEXAMPLE:session_name", *user.AssumedRoleId, "Expect assumed role ID to match")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestAssumeRoleProviderCrossPartition(t *testing.T) {
+	svc := sts.New(unit.Session, &aws.Config{Region: aws.String("us-west-2")})
+	svc.Handlers.Send.Clear()
+	svc.Handlers.Send.PushBack(func(r *request.Request) {
+		t.Errorf("Expect STS not to be called, got %s", r.Operation.Name)
+	})
+	p := &AssumeRoleProvider{
+		Client:  svc,
+		RoleARN: "arn:aws-cn:iam::123456789012:role/role_name",
+	}
+
+	creds, err := p.Retrieve()
+	assert.Error(t, err, "Expect cross partition error")
+	assert.Equal(t, ErrCodeCrossPartition, err.(awserr.Error).Code(), "Expect cross partition error code")
+	assert.Equal(t, ProviderName, creds.ProviderName, "Expect provider name to be set")
+}
+
+func TestAssumeRoleProviderValidatePartition(t *testing.T) {
+	cases := []struct {
+		client    AssumeRoler
+		roleARN   string
+		expectErr bool
+	}{
+		{sts.New(unit.Session, &aws.Config{Region: aws.String("us-west-2")}), "arn:aws:iam::123456789012:role/role_name", false},
+		{sts.New(unit.Session, &aws.Config{Region: aws.String("us-west-2")}), "arn:aws-cn:iam::123456789012:role/role_name", true},
+		{sts.New(unit.Session, &aws.Config{Region: aws.String("us-west-2")}), "arn:aws-us-gov:iam::123456789012:role/role_name", true},
+		{sts.New(unit.Session, &aws.Config{Region: aws.String("us-gov-west-1")}), "arn:aws-us-gov:iam::123456789012:role/role_name", false},
+		{sts.New(unit.Session, &aws.Config{Region: aws.String("us-gov-west-1")}), "arn:aws:iam::123456789012:role/role_name", true},
+		{sts.New(unit.Session, &aws.Config{Region: aws.String("cn-north-1")}), "arn:aws-cn:iam::123456789012:role/role_name", false},
+		{sts.New(unit.Session, &aws.Config{Region: aws.String("us-west-2")}), "roleARN", false},
+		{sts.New(unit.Session, &aws.Config{Region: aws.String("us-iso-east-1")}), "arn:aws-iso:iam::123456789012:role/role_name", false},
+		{sts.New(unit.Session, &aws.Config{Region: aws.String("mock-region")}), "arn:aws:iam::123456789012:role/role_name", false},
+		{&stubSTS{}, "arn:aws-cn:iam::123456789012:role/role_name", false},
+	}
+
+	for i, c := range cases {
+		p := &AssumeRoleProvider{Client: c.client, RoleARN: c.roleARN}
+		err := p.validatePartition()
+		if c.expectErr {
+			assert.Error(t, err, "Expect error, case %d", i)
+			assert.Equal(t, ErrCodeCrossPartition, err.(awserr.Error).Code(), "Expect cross partition error code, case %d", i)
+		} else {
+			assert.Nil(t, err, "Expect no error, case %d", i)
+		}
+	}
+}
+
+func TestARNPartition(t *testing.T) {
+	cases := []struct {
+		arn, expect string
+	}{
+		{"arn:aws:iam::123456789012:role/role_name", "aws"},
+		{"arn:aws-cn:iam::123456789012:role/role_name", "aws-cn"},
+		{"arn:aws-us-gov:iam::123456789012:role/role_name", "aws-us-gov"},
+		{"roleARN", ""},
+		{"arn:aws", ""},
+		{"", ""},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expect, arnPartition(c.arn), "Expect partition to match for %q", c.arn)
+	}
+}
+
+func TestRegionPartition(t *testing.T) {
+	cases := []struct {
+		region, expect string
+	}{
+		{"us-west-2", "aws"},
+		{"eu-central-1", "aws"},
+		{"ap-southeast-2", "aws"},
+		{"cn-northwest-1", "aws-cn"},
+		{"us-gov-east-1", "aws-us-gov"},
+		{"us-iso-east-1", ""},
+		{"us-isob-east-1", ""},
+		{"mock-region", ""},
+		{"cn-north-1", "aws-cn"},
+		{"us-gov-west-1", "aws-us-gov"},
+		{"", ""},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expect, regionPartition(c.region), "Expect partition to match for %q", c.region)
+	}
+}
+
+type stubSTSWithMFA struct {
+	stubSTS
+	input *sts.AssumeRoleInput
+}
+
+func (s *stubSTSWithMFA) AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	s.input = input
+	return s.stubSTS.AssumeRole(input)
+}
+
+func TestAssumeRoleProviderWithTokenProviderChain(t *testing.T) {
+	stub := &stubSTSWithMFA{}
+	p := &AssumeRoleProvider{
+		Client:       stub,
+		RoleARN:      "roleARN",
+		SerialNumber: aws.String("0123456789"),
+		TokenProvider: ChainTokenProviders(
+			func() (string, error) { return "", errors.New("no hardware token") },
+			func() (string, error) { return "654321", nil },
+		),
+	}
+
+	_, err := p.Retrieve()
+	assert.Nil(t, err, "Expect no error")
+
+	assert.Equal(t, "0123456789", *stub.input.SerialNumber, "Expect serial number to match")
+	assert.Equal(t, "654321", *stub.input.TokenCode, "Expect token code from second provider")
+}
+
+func TestAssumeRoleProviderWithTokenProviderChainFailed(t *testing.T) {
+	stub := &stubSTSWithMFA{}
+	p := &AssumeRoleProvider{
+		Client:       stub,
+		RoleARN:      "roleARN",
+		SerialNumber: aws.String("0123456789"),
+		TokenProvider: ChainTokenProviders(
+			func() (string, error) { return "", errors.New("no hardware token") },
+		),
+	}
+
+	_, err := p.Retrieve()
+	assert.Error(t, err, "Expect error")
+	assert.Equal(t, "AssumeRoleTokenNotAvailable", err.(awserr.Error).Code(), "Expect token not available error code")
+	assert.Nil(t, stub.input, "Expect STS not to be called")
+}
+
+func TestAssumeRoleProviderWithTokenProviderChainSkipsEmptyCode(t *testing.T) {
+	stub := &stubSTSWithMFA{}
+	p := &AssumeRoleProvider{
+		Client:       stub,
+		RoleARN:      "roleARN",
+		SerialNumber: aws.String("0123456789"),
+		TokenProvider: ChainTokenProviders(
+			func() (string, error) { return "", nil },
+			func() (string, error) { return "654321", nil },
+		),
+	}
+
+	_, err := p.Retrieve()
+	assert.Nil(t, err, "Expect no error")
+	assert.Equal(t, "654321", *stub.input.TokenCode, "Expect empty token code to be skipped")
+}
+
+func TestChainTokenProvidersErrors(t *testing.T) {
+	_, err := ChainTokenProviders()()
+	assert.Equal(t, "NoTokenProviders", err.(awserr.Error).Code(), "Expect no token providers error code")
+
+	_, err = ChainTokenProviders(
+		func() (string, error) { return "", errors.New("no hardware token") },
+		func() (string, error) { return "", nil },
+	)()
+	batchErr := err.(awserr.BatchError)
+	assert.Equal(t, "TokenProvidersFailed", batchErr.Code(), "Expect token providers failed error code")
+	assert.Len(t, batchErr.OrigErrs(), 2, "Expect an error for each provider")
+}
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 Appendix B SHA1 test vectors, truncated to 6 digits.
+	key := []byte("12345678901234567890")
+	cases := []struct {
+		unix   int64
+		expect string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expect, totpCode(key, time.Unix(c.unix, 0)), "Expect token code to match at %d", c.unix)
+	}
+}
+
+func TestTOTPTokenProvider(t *testing.T) {
+	code, err := TOTPTokenProvider("gezd gnbv gy3t qojq gezd gnbv gy3t qojq")()
+	assert.Nil(t, err, "Expect no error")
+	assert.Len(t, code, 6, "Expect 6 digit token code")
+
+	// 20 byte secrets encode to 32 characters, so drop bytes to exercise
+	// the padding of secrets whose length is not a multiple of 8.
+	code, err = TOTPTokenProvider("gezdgnbvgy3tqojqgezdgnbvgy3tqoi")()
+	assert.Nil(t, err, "Expect no error for unpadded secret")
+	assert.Len(t, code, 6, "Expect 6 digit token code")
+
+	code, err = TOTPTokenProvider("GEZDGNBVGY3TQOI=")()
+	assert.Nil(t, err, "Expect no error for padded secret")
+	assert.Len(t, code, 6, "Expect 6 digit token code")
+
+	_, err = TOTPTokenProvider("not base32!")()
+	assert.Equal(t, "InvalidTOTPSecret", err.(awserr.Error).Code(), "Expect invalid secret error code")
+
+	_, err = TOTPTokenProvider("")()
+	assert.Equal(t, "InvalidTOTPSecret", err.(awserr.Error).Code(), "Expect invalid secret error code")
+}
+
 func BenchmarkAssumeRoleProvider(b *testing.B) {
 	stub := &stubSTS{}
 	p := &AssumeRoleProvider{